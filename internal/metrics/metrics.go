@@ -0,0 +1,445 @@
+// Package metrics exposes the Prometheus collectors used by the sentinel to
+// report on resource polling, event publication, and error conditions.
+package metrics
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openshift-hyperfleet/hyperfleet-sentinel/internal/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	componentName    = "sentinel"
+	metricsSubsystem = "hyperfleet_sentinel"
+
+	metricsResourceTypeLabel     = "resource_type"
+	metricsResourceSelectorLabel = "resource_selector"
+	metricsReasonLabel           = "reason"
+	metricsErrorTypeLabel        = "error_type"
+
+	// defaultReapInterval controls how often the TTL reaper sweeps for
+	// stale label combinations. It is independent of the TTL itself so a
+	// short TTL doesn't force an equally tight sweep loop.
+	defaultReapInterval = 30 * time.Second
+)
+
+var (
+	// MetricsLabels is the label set shared by metrics keyed only on
+	// resource type and selector.
+	MetricsLabels = []string{metricsResourceTypeLabel, metricsResourceSelectorLabel}
+	// MetricsLabelsWithReason adds a "reason" label, used by metrics that
+	// explain why something happened (e.g. an event was published).
+	MetricsLabelsWithReason = []string{metricsResourceTypeLabel, metricsResourceSelectorLabel, metricsReasonLabel}
+	// MetricsLabelsWithErrorType adds an "error_type" label, used by error
+	// counters.
+	MetricsLabelsWithErrorType = []string{metricsResourceTypeLabel, metricsResourceSelectorLabel, metricsErrorTypeLabel}
+
+	// MetricsNames lists every metric name exposed by SentinelMetrics.
+	MetricsNames = []string{
+		"pending_resources",
+		"events_published_total",
+		"resources_skipped_total",
+		"poll_duration_seconds",
+		"api_errors_total",
+		"broker_errors_total",
+	}
+)
+
+// SentinelMetrics bundles all Prometheus collectors exposed by the sentinel.
+type SentinelMetrics struct {
+	PendingResources *prometheus.GaugeVec
+	EventsPublished  *prometheus.CounterVec
+	ResourcesSkipped *prometheus.CounterVec
+	PollDuration     *prometheus.HistogramVec
+	APIErrors        *prometheus.CounterVec
+	BrokerErrors     *prometheus.CounterVec
+
+	ttl        time.Duration
+	reapCancel context.CancelFunc
+	reapDone   chan struct{}
+}
+
+var (
+	metricsMu       sync.Mutex
+	metricsInstance *SentinelMetrics
+
+	pendingResourcesGauge   *prometheus.GaugeVec
+	eventsPublishedCounter  *prometheus.CounterVec
+	resourcesSkippedCounter *prometheus.CounterVec
+	pollDurationHistogram   *prometheus.HistogramVec
+	apiErrorsCounter        *prometheus.CounterVec
+	brokerErrorsCounter     *prometheus.CounterVec
+
+	// lastUpdated tracks, per label combination, the time it was last
+	// written by one of the Update* helpers below. The TTL reaper uses it
+	// to find and delete label combinations nobody is updating anymore.
+	lastUpdated sync.Map
+)
+
+// Option configures optional behavior of NewSentinelMetrics.
+type Option func(*metricsOptions)
+
+type metricsOptions struct {
+	ttl time.Duration
+
+	queueSize     int
+	batchSize     int
+	flushInterval time.Duration
+}
+
+// WithTTL expires a label combination (resource_type, resource_selector,
+// and reason/error_type when present) once it hasn't been updated for the
+// given duration. A TTL of 0, the default, preserves today's behavior of
+// series living for the lifetime of the process.
+func WithTTL(ttl time.Duration) Option {
+	return func(o *metricsOptions) {
+		o.ttl = ttl
+	}
+}
+
+// seriesKey identifies a single label combination of a single collector, so
+// the reaper can delete it via the right vec's DeleteLabelValues.
+type seriesKey struct {
+	collector        string
+	resourceType     string
+	resourceSelector string
+	extra            string
+}
+
+// NewSentinelMetrics creates and registers the sentinel's Prometheus
+// collectors against registry. It is idempotent: subsequent calls return the
+// instance created by the first call until ResetSentinelMetrics is used to
+// tear it down (tests rely on this to get a clean registry per test case).
+func NewSentinelMetrics(registry prometheus.Registerer, version string, opts ...Option) *SentinelMetrics {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	if metricsInstance != nil {
+		return metricsInstance
+	}
+
+	options := &metricsOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	constLabels := prometheus.Labels{
+		"component": componentName,
+		"version":   version,
+	}
+
+	pendingResourcesGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem:   metricsSubsystem,
+		Name:        "pending_resources",
+		Help:        "Number of resources awaiting processing, labeled by resource type and selector.",
+		ConstLabels: constLabels,
+	}, MetricsLabels)
+
+	eventsPublishedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem:   metricsSubsystem,
+		Name:        "events_published_total",
+		Help:        "Total number of events published, labeled by resource type, selector, and reason.",
+		ConstLabels: constLabels,
+	}, MetricsLabelsWithReason)
+
+	resourcesSkippedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem:   metricsSubsystem,
+		Name:        "resources_skipped_total",
+		Help:        "Total number of resources skipped, labeled by resource type, selector, and reason.",
+		ConstLabels: constLabels,
+	}, MetricsLabelsWithReason)
+
+	pollDurationHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Subsystem:   metricsSubsystem,
+		Name:        "poll_duration_seconds",
+		Help:        "Duration of polling operations in seconds, labeled by resource type and selector.",
+		ConstLabels: constLabels,
+		Buckets:     prometheus.DefBuckets,
+	}, MetricsLabels)
+
+	apiErrorsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem:   metricsSubsystem,
+		Name:        "api_errors_total",
+		Help:        "Total number of API errors, labeled by resource type, selector, and error type.",
+		ConstLabels: constLabels,
+	}, MetricsLabelsWithErrorType)
+
+	brokerErrorsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem:   metricsSubsystem,
+		Name:        "broker_errors_total",
+		Help:        "Total number of broker errors, labeled by resource type, selector, and error type.",
+		ConstLabels: constLabels,
+	}, MetricsLabelsWithErrorType)
+
+	registry.MustRegister(
+		pendingResourcesGauge,
+		eventsPublishedCounter,
+		resourcesSkippedCounter,
+		pollDurationHistogram,
+		apiErrorsCounter,
+		brokerErrorsCounter,
+	)
+
+	metricsInstance = &SentinelMetrics{
+		PendingResources: pendingResourcesGauge,
+		EventsPublished:  eventsPublishedCounter,
+		ResourcesSkipped: resourcesSkippedCounter,
+		PollDuration:     pollDurationHistogram,
+		APIErrors:        apiErrorsCounter,
+		BrokerErrors:     brokerErrorsCounter,
+		ttl:              options.ttl,
+	}
+
+	if options.ttl > 0 {
+		startReaper(metricsInstance)
+	}
+
+	initCustomMetrics(registry, constLabels)
+
+	return metricsInstance
+}
+
+// Close stops the TTL reaper goroutine, if one was started. It is safe to
+// call on a nil *SentinelMetrics or more than once.
+func (m *SentinelMetrics) Close() {
+	if m == nil {
+		return
+	}
+	stopQueue()
+	if m.reapCancel == nil {
+		return
+	}
+	m.reapCancel()
+	<-m.reapDone
+}
+
+// ResetSentinelMetrics tears down the current SentinelMetrics instance so a
+// fresh one can be created against a new registry. It exists primarily for
+// tests; production code creates the metrics once at startup.
+func ResetSentinelMetrics() {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	if metricsInstance != nil {
+		metricsInstance.Close()
+	}
+
+	metricsInstance = nil
+	pendingResourcesGauge = nil
+	eventsPublishedCounter = nil
+	resourcesSkippedCounter = nil
+	pollDurationHistogram = nil
+	apiErrorsCounter = nil
+	brokerErrorsCounter = nil
+	lastUpdated = sync.Map{}
+	resetCustomMetrics()
+}
+
+func startReaper(m *SentinelMetrics) {
+	ctx, cancel := context.WithCancel(context.Background())
+	m.reapCancel = cancel
+	m.reapDone = make(chan struct{})
+
+	go func() {
+		defer close(m.reapDone)
+
+		ticker := time.NewTicker(defaultReapInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				reapStaleSeries(m.ttl)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func reapStaleSeries(ttl time.Duration) {
+	now := time.Now()
+	lastUpdated.Range(func(key, value interface{}) bool {
+		k := key.(seriesKey)
+		last := value.(time.Time)
+		if now.Sub(last) < ttl {
+			return true
+		}
+		deleteSeries(k)
+		lastUpdated.Delete(k)
+		return true
+	})
+}
+
+func deleteSeries(k seriesKey) {
+	labels := prometheus.Labels{
+		metricsResourceTypeLabel:     k.resourceType,
+		metricsResourceSelectorLabel: k.resourceSelector,
+	}
+	switch k.collector {
+	case "pending_resources":
+		pendingResourcesGauge.Delete(labels)
+	case "events_published_total":
+		labels[metricsReasonLabel] = k.extra
+		eventsPublishedCounter.Delete(labels)
+	case "resources_skipped_total":
+		labels[metricsReasonLabel] = k.extra
+		resourcesSkippedCounter.Delete(labels)
+	case "poll_duration_seconds":
+		pollDurationHistogram.Delete(labels)
+	case "api_errors_total":
+		labels[metricsErrorTypeLabel] = k.extra
+		apiErrorsCounter.Delete(labels)
+	case "broker_errors_total":
+		labels[metricsErrorTypeLabel] = k.extra
+		brokerErrorsCounter.Delete(labels)
+	}
+}
+
+func touch(collector, resourceType, resourceSelector, extra string) {
+	lastUpdated.Store(seriesKey{
+		collector:        collector,
+		resourceType:     resourceType,
+		resourceSelector: resourceSelector,
+		extra:            extra,
+	}, time.Now())
+}
+
+// UpdatePendingResourcesMetric sets the current count of pending resources
+// for a resource type and selector. Negative counts are clamped to zero.
+func UpdatePendingResourcesMetric(resourceType, resourceSelector string, count int) {
+	if resourceType == "" || resourceSelector == "" {
+		return
+	}
+	if count < 0 {
+		count = 0
+	}
+
+	if tryRecordEvent(metricEvent{metric: "pending_resources", resourceType: resourceType, resourceSelector: resourceSelector, value: float64(count)}) {
+		return
+	}
+
+	pendingResourcesGauge.With(prometheus.Labels{
+		metricsResourceTypeLabel:     resourceType,
+		metricsResourceSelectorLabel: resourceSelector,
+	}).Set(float64(count))
+	touch("pending_resources", resourceType, resourceSelector, "")
+}
+
+// UpdateEventsPublishedMetric increments the count of events published for a
+// resource type, selector, and reason.
+func UpdateEventsPublishedMetric(resourceType, resourceSelector, reason string) {
+	if resourceType == "" || resourceSelector == "" || reason == "" {
+		return
+	}
+
+	if tryRecordEvent(metricEvent{metric: "events_published_total", resourceType: resourceType, resourceSelector: resourceSelector, extra: reason, value: 1}) {
+		return
+	}
+
+	eventsPublishedCounter.With(prometheus.Labels{
+		metricsResourceTypeLabel:     resourceType,
+		metricsResourceSelectorLabel: resourceSelector,
+		metricsReasonLabel:           reason,
+	}).Inc()
+	touch("events_published_total", resourceType, resourceSelector, reason)
+}
+
+// UpdateResourcesSkippedMetric increments the count of resources skipped for
+// a resource type, selector, and reason.
+func UpdateResourcesSkippedMetric(resourceType, resourceSelector, reason string) {
+	if resourceType == "" || resourceSelector == "" || reason == "" {
+		return
+	}
+
+	if tryRecordEvent(metricEvent{metric: "resources_skipped_total", resourceType: resourceType, resourceSelector: resourceSelector, extra: reason, value: 1}) {
+		return
+	}
+
+	resourcesSkippedCounter.With(prometheus.Labels{
+		metricsResourceTypeLabel:     resourceType,
+		metricsResourceSelectorLabel: resourceSelector,
+		metricsReasonLabel:           reason,
+	}).Inc()
+	touch("resources_skipped_total", resourceType, resourceSelector, reason)
+}
+
+// UpdatePollDurationMetric records how long a poll took for a resource type
+// and selector. Negative durations are ignored.
+func UpdatePollDurationMetric(resourceType, resourceSelector string, durationSeconds float64) {
+	if resourceType == "" || resourceSelector == "" || durationSeconds < 0 {
+		return
+	}
+
+	if tryRecordEvent(metricEvent{metric: "poll_duration_seconds", resourceType: resourceType, resourceSelector: resourceSelector, value: durationSeconds}) {
+		return
+	}
+
+	pollDurationHistogram.With(prometheus.Labels{
+		metricsResourceTypeLabel:     resourceType,
+		metricsResourceSelectorLabel: resourceSelector,
+	}).Observe(durationSeconds)
+	touch("poll_duration_seconds", resourceType, resourceSelector, "")
+}
+
+// UpdateAPIErrorsMetric increments the count of API errors for a resource
+// type, selector, and error type.
+func UpdateAPIErrorsMetric(resourceType, resourceSelector, errorType string) {
+	if resourceType == "" || resourceSelector == "" || errorType == "" {
+		return
+	}
+
+	if tryRecordEvent(metricEvent{metric: "api_errors_total", resourceType: resourceType, resourceSelector: resourceSelector, extra: errorType, value: 1}) {
+		return
+	}
+
+	apiErrorsCounter.With(prometheus.Labels{
+		metricsResourceTypeLabel:     resourceType,
+		metricsResourceSelectorLabel: resourceSelector,
+		metricsErrorTypeLabel:        errorType,
+	}).Inc()
+	touch("api_errors_total", resourceType, resourceSelector, errorType)
+}
+
+// UpdateBrokerErrorsMetric increments the count of broker errors for a
+// resource type, selector, and error type.
+func UpdateBrokerErrorsMetric(resourceType, resourceSelector, errorType string) {
+	if resourceType == "" || resourceSelector == "" || errorType == "" {
+		return
+	}
+
+	if tryRecordEvent(metricEvent{metric: "broker_errors_total", resourceType: resourceType, resourceSelector: resourceSelector, extra: errorType, value: 1}) {
+		return
+	}
+
+	brokerErrorsCounter.With(prometheus.Labels{
+		metricsResourceTypeLabel:     resourceType,
+		metricsResourceSelectorLabel: resourceSelector,
+		metricsErrorTypeLabel:        errorType,
+	}).Inc()
+	touch("broker_errors_total", resourceType, resourceSelector, errorType)
+}
+
+// GetResourceSelectorLabel renders a label selector list into the flattened
+// "label:value,label:value" form used for the resource_selector label, or
+// "all" when no selectors are configured.
+func GetResourceSelectorLabel(selectors config.LabelSelectorList) string {
+	if len(selectors) == 0 {
+		return "all"
+	}
+
+	var b strings.Builder
+	for i, s := range selectors {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(s.Label)
+		b.WriteByte(':')
+		b.WriteString(s.Value)
+	}
+	return b.String()
+}
@@ -0,0 +1,314 @@
+package metrics
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CustomMetricType identifies which kind of Prometheus collector a
+// CustomMetricSpec should be backed by.
+type CustomMetricType string
+
+const (
+	CustomMetricCounter   CustomMetricType = "counter"
+	CustomMetricGauge     CustomMetricType = "gauge"
+	CustomMetricHistogram CustomMetricType = "histogram"
+)
+
+// CustomMetricSpec describes an operator-defined metric, declared via
+// config rather than compiled in, and registered at runtime with
+// RegisterCustomMetric.
+type CustomMetricSpec struct {
+	Name    string
+	Help    string
+	Type    CustomMetricType
+	Labels  []string
+	Buckets []float64 // histogram only; defaults to prometheus.DefBuckets
+}
+
+// metricSignature is the (type, labels) a custom metric name was first
+// registered with, used to detect conflicting re-registrations.
+type metricSignature struct {
+	mtype  CustomMetricType
+	labels []string
+}
+
+// metricChecker rejects registering a metric name under a second, different
+// signature - e.g. a counter redeclared as a gauge, or the same name
+// redeclared with a different label set. It also tracks each accepted
+// signature so UpdateCustomMetric knows how to apply a value. Every method
+// is called with customMu already held, so it needs no lock of its own.
+type metricChecker struct {
+	specs map[string]metricSignature
+}
+
+func newMetricChecker() *metricChecker {
+	return &metricChecker{specs: make(map[string]metricSignature)}
+}
+
+// check validates that (t, labels) is compatible with whatever name was
+// previously registered under, without reserving anything. Callers must only
+// call set once the underlying collector has actually been registered, so a
+// spec that fails registration (e.g. it collides with a name registered
+// outside the custom-metric path, like one of the queue collectors) never
+// poisons the name for a later, non-conflicting attempt.
+func (c *metricChecker) check(name string, t CustomMetricType, labels []string) error {
+	existing, ok := c.specs[name]
+	if !ok {
+		return nil
+	}
+
+	if existing.mtype != t {
+		return fmt.Errorf("metrics: custom metric %q is already registered as a %s, cannot redeclare as a %s", name, existing.mtype, t)
+	}
+	if len(existing.labels) != len(labels) {
+		return fmt.Errorf("metrics: custom metric %q is already registered with %d labels, got %d", name, len(existing.labels), len(labels))
+	}
+	for i, l := range existing.labels {
+		if labels[i] != l {
+			return fmt.Errorf("metrics: custom metric %q already has label %q in position %d, got %q", name, l, i, labels[i])
+		}
+	}
+	return nil
+}
+
+// set records (t, labels) as name's signature. Only call this after the
+// backing collector has been registered successfully.
+func (c *metricChecker) set(name string, t CustomMetricType, labels []string) {
+	c.specs[name] = metricSignature{mtype: t, labels: append([]string(nil), labels...)}
+}
+
+func (c *metricChecker) signature(name string) (metricSignature, bool) {
+	sig, ok := c.specs[name]
+	return sig, ok
+}
+
+// counterContainer, gaugeContainer, and histogramContainer each hold every
+// custom metric of their type registered so far, keyed by name - mirroring
+// statsd_exporter's per-type Container design. Like metricChecker, they're
+// only ever touched with customMu held.
+type counterContainer struct {
+	elements map[string]*prometheus.CounterVec
+}
+
+func newCounterContainer() *counterContainer {
+	return &counterContainer{elements: make(map[string]*prometheus.CounterVec)}
+}
+
+// Register registers spec's backing CounterVec, unless one is already
+// cached for this name. It uses Register rather than MustRegister so a name
+// collision with a collector registered outside the custom-metric path
+// (e.g. one of the queue collectors) comes back as an error instead of a
+// panic, and the vec is only cached once registration has actually
+// succeeded.
+func (c *counterContainer) Register(spec CustomMetricSpec, constLabels prometheus.Labels, registry prometheus.Registerer) error {
+	if _, ok := c.elements[spec.Name]; ok {
+		return nil
+	}
+
+	vec := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem:   metricsSubsystem,
+		Name:        spec.Name,
+		Help:        spec.Help,
+		ConstLabels: constLabels,
+	}, spec.Labels)
+	if err := registry.Register(vec); err != nil {
+		return err
+	}
+	c.elements[spec.Name] = vec
+	return nil
+}
+
+type gaugeContainer struct {
+	elements map[string]*prometheus.GaugeVec
+}
+
+func newGaugeContainer() *gaugeContainer {
+	return &gaugeContainer{elements: make(map[string]*prometheus.GaugeVec)}
+}
+
+// Register registers spec's backing GaugeVec; see counterContainer.Register.
+func (c *gaugeContainer) Register(spec CustomMetricSpec, constLabels prometheus.Labels, registry prometheus.Registerer) error {
+	if _, ok := c.elements[spec.Name]; ok {
+		return nil
+	}
+
+	vec := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem:   metricsSubsystem,
+		Name:        spec.Name,
+		Help:        spec.Help,
+		ConstLabels: constLabels,
+	}, spec.Labels)
+	if err := registry.Register(vec); err != nil {
+		return err
+	}
+	c.elements[spec.Name] = vec
+	return nil
+}
+
+type histogramContainer struct {
+	elements map[string]*prometheus.HistogramVec
+}
+
+func newHistogramContainer() *histogramContainer {
+	return &histogramContainer{elements: make(map[string]*prometheus.HistogramVec)}
+}
+
+// Register registers spec's backing HistogramVec; see
+// counterContainer.Register.
+func (c *histogramContainer) Register(spec CustomMetricSpec, constLabels prometheus.Labels, registry prometheus.Registerer) error {
+	if _, ok := c.elements[spec.Name]; ok {
+		return nil
+	}
+
+	buckets := spec.Buckets
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+
+	vec := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Subsystem:   metricsSubsystem,
+		Name:        spec.Name,
+		Help:        spec.Help,
+		ConstLabels: constLabels,
+		Buckets:     buckets,
+	}, spec.Labels)
+	if err := registry.Register(vec); err != nil {
+		return err
+	}
+	c.elements[spec.Name] = vec
+	return nil
+}
+
+var (
+	// customMu guards every package var below, and registration is only
+	// ever done under it, so a signature check and the vec creation it
+	// gates always happen atomically - UpdateCustomMetric can never
+	// observe a name that passed the checker but has no vec yet.
+	customMu          sync.Mutex
+	customChecker     *metricChecker
+	customCounters    *counterContainer
+	customGauges      *gaugeContainer
+	customHistograms  *histogramContainer
+	customConstLabels prometheus.Labels
+	customRegistry    prometheus.Registerer
+)
+
+// initCustomMetrics wires up the custom metric registry for the given
+// registry/ConstLabels, so RegisterCustomMetric inherits the same
+// component/version labels as the built-in collectors. Called from
+// NewSentinelMetrics.
+func initCustomMetrics(registry prometheus.Registerer, constLabels prometheus.Labels) {
+	customMu.Lock()
+	defer customMu.Unlock()
+
+	customChecker = newMetricChecker()
+	customCounters = newCounterContainer()
+	customGauges = newGaugeContainer()
+	customHistograms = newHistogramContainer()
+	customConstLabels = constLabels
+	customRegistry = registry
+}
+
+func resetCustomMetrics() {
+	customMu.Lock()
+	defer customMu.Unlock()
+
+	customChecker = nil
+	customCounters = nil
+	customGauges = nil
+	customHistograms = nil
+	customConstLabels = nil
+	customRegistry = nil
+}
+
+// RegisterCustomMetric declares an operator-defined counter, gauge, or
+// histogram without requiring a recompile - e.g. a per-shard SLO counter
+// supplied via config. It fails if spec.Name was already registered with a
+// different type or label set, or collides with any other collector already
+// registered against the registry - a built-in MetricsNames collector, one
+// of the queue collectors from NewSentinelMetricsWithQueue, or another
+// custom metric; re-registering with the same signature is a no-op that
+// keeps the existing collector and returns nil.
+func RegisterCustomMetric(spec CustomMetricSpec) error {
+	if spec.Name == "" {
+		return fmt.Errorf("metrics: custom metric name must not be empty")
+	}
+	switch spec.Type {
+	case CustomMetricCounter, CustomMetricGauge, CustomMetricHistogram:
+	default:
+		return fmt.Errorf("metrics: unknown custom metric type %q for %q", spec.Type, spec.Name)
+	}
+	for _, builtin := range MetricsNames {
+		if spec.Name == builtin {
+			return fmt.Errorf("metrics: custom metric %q collides with a built-in metric name", spec.Name)
+		}
+	}
+
+	customMu.Lock()
+	defer customMu.Unlock()
+
+	if customChecker == nil {
+		return fmt.Errorf("metrics: RegisterCustomMetric called before NewSentinelMetrics")
+	}
+
+	if err := customChecker.check(spec.Name, spec.Type, spec.Labels); err != nil {
+		return err
+	}
+
+	// Attempt the actual registration before recording the signature, so a
+	// spec that collides with something registered outside the
+	// custom-metric path (e.g. metric_queue_depth) returns a clean error
+	// instead of reserving a name that can never successfully register.
+	var err error
+	switch spec.Type {
+	case CustomMetricCounter:
+		err = customCounters.Register(spec, customConstLabels, customRegistry)
+	case CustomMetricGauge:
+		err = customGauges.Register(spec, customConstLabels, customRegistry)
+	case CustomMetricHistogram:
+		err = customHistograms.Register(spec, customConstLabels, customRegistry)
+	}
+	if err != nil {
+		return fmt.Errorf("metrics: failed to register custom metric %q: %w", spec.Name, err)
+	}
+
+	customChecker.set(spec.Name, spec.Type, spec.Labels)
+	return nil
+}
+
+// UpdateCustomMetric applies value to a metric previously declared with
+// RegisterCustomMetric, mirroring the built-in Update* helpers: counters are
+// incremented by value, gauges are set to value, and histograms observe
+// value. Unregistered names and label sets that don't match the metric's
+// declared labels are silently ignored.
+func UpdateCustomMetric(name string, labels prometheus.Labels, value float64) {
+	customMu.Lock()
+	defer customMu.Unlock()
+
+	if customChecker == nil {
+		return
+	}
+
+	sig, ok := customChecker.signature(name)
+	if !ok {
+		return
+	}
+
+	switch sig.mtype {
+	case CustomMetricCounter:
+		if m, err := customCounters.elements[name].GetMetricWith(labels); err == nil {
+			m.Add(value)
+		}
+	case CustomMetricGauge:
+		if m, err := customGauges.elements[name].GetMetricWith(labels); err == nil {
+			m.Set(value)
+		}
+	case CustomMetricHistogram:
+		if m, err := customHistograms.elements[name].GetMetricWith(labels); err == nil {
+			m.Observe(value)
+		}
+	}
+}
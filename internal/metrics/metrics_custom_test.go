@@ -0,0 +1,181 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRegisterCustomMetric_CounterGaugeHistogram(t *testing.T) {
+	initTestMetrics(t)
+
+	specs := []CustomMetricSpec{
+		{Name: "shard_slo_total", Help: "SLO breaches per shard.", Type: CustomMetricCounter, Labels: []string{"shard"}},
+		{Name: "shard_backlog", Help: "Current shard backlog.", Type: CustomMetricGauge, Labels: []string{"shard"}},
+		{Name: "shard_latency_seconds", Help: "Shard request latency.", Type: CustomMetricHistogram, Labels: []string{"shard"}},
+	}
+
+	for _, spec := range specs {
+		if err := RegisterCustomMetric(spec); err != nil {
+			t.Fatalf("RegisterCustomMetric(%s) returned error: %v", spec.Name, err)
+		}
+	}
+
+	UpdateCustomMetric("shard_slo_total", prometheus.Labels{"shard": "1"}, 1)
+	UpdateCustomMetric("shard_backlog", prometheus.Labels{"shard": "1"}, 42)
+	UpdateCustomMetric("shard_latency_seconds", prometheus.Labels{"shard": "1"}, 0.25)
+
+	if got := testutil.ToFloat64(customCounters.elements["shard_slo_total"].With(prometheus.Labels{"shard": "1"})); got != 1 {
+		t.Errorf("Expected shard_slo_total to be 1, got %f", got)
+	}
+	if got := testutil.ToFloat64(customGauges.elements["shard_backlog"].With(prometheus.Labels{"shard": "1"})); got != 42 {
+		t.Errorf("Expected shard_backlog to be 42, got %f", got)
+	}
+}
+
+func TestRegisterCustomMetric_TypeConflict(t *testing.T) {
+	initTestMetrics(t)
+
+	if err := RegisterCustomMetric(CustomMetricSpec{Name: "shard_slo_total", Type: CustomMetricCounter, Labels: []string{"shard"}}); err != nil {
+		t.Fatalf("unexpected error on first registration: %v", err)
+	}
+
+	err := RegisterCustomMetric(CustomMetricSpec{Name: "shard_slo_total", Type: CustomMetricGauge, Labels: []string{"shard"}})
+	if err == nil {
+		t.Fatal("Expected error when redeclaring a counter as a gauge, got nil")
+	}
+}
+
+func TestRegisterCustomMetric_LabelMismatch(t *testing.T) {
+	initTestMetrics(t)
+
+	if err := RegisterCustomMetric(CustomMetricSpec{Name: "shard_slo_total", Type: CustomMetricCounter, Labels: []string{"shard"}}); err != nil {
+		t.Fatalf("unexpected error on first registration: %v", err)
+	}
+
+	err := RegisterCustomMetric(CustomMetricSpec{Name: "shard_slo_total", Type: CustomMetricCounter, Labels: []string{"shard", "region"}})
+	if err == nil {
+		t.Fatal("Expected error when redeclaring with a different label set, got nil")
+	}
+}
+
+func TestRegisterCustomMetric_SameSignatureIsNoOp(t *testing.T) {
+	initTestMetrics(t)
+
+	spec := CustomMetricSpec{Name: "shard_slo_total", Type: CustomMetricCounter, Labels: []string{"shard"}}
+	if err := RegisterCustomMetric(spec); err != nil {
+		t.Fatalf("unexpected error on first registration: %v", err)
+	}
+	if err := RegisterCustomMetric(spec); err != nil {
+		t.Fatalf("expected re-registering the same signature to succeed, got: %v", err)
+	}
+}
+
+func TestUpdateCustomMetric_LabelCardinalityMismatchIgnored(t *testing.T) {
+	initTestMetrics(t)
+
+	if err := RegisterCustomMetric(CustomMetricSpec{Name: "shard_slo_total", Type: CustomMetricCounter, Labels: []string{"shard"}}); err != nil {
+		t.Fatalf("unexpected error registering metric: %v", err)
+	}
+
+	// One label more than the metric declares; should be ignored, not panic.
+	UpdateCustomMetric("shard_slo_total", prometheus.Labels{"shard": "1", "region": "us-east"}, 1)
+
+	if got := testutil.CollectAndCount(customCounters.elements["shard_slo_total"]); got != 0 {
+		t.Errorf("Expected no series to be recorded for a label-cardinality mismatch, got %d", got)
+	}
+}
+
+func TestUpdateCustomMetric_UnregisteredNameIgnored(t *testing.T) {
+	initTestMetrics(t)
+
+	// Should not panic even though "unknown_metric" was never registered.
+	UpdateCustomMetric("unknown_metric", prometheus.Labels{"shard": "1"}, 1)
+}
+
+func TestRegisterCustomMetric_ResetClearsRegistrations(t *testing.T) {
+	initTestMetrics(t)
+
+	if err := RegisterCustomMetric(CustomMetricSpec{Name: "shard_slo_total", Type: CustomMetricCounter, Labels: []string{"shard"}}); err != nil {
+		t.Fatalf("unexpected error registering metric: %v", err)
+	}
+
+	ResetSentinelMetrics()
+
+	if customChecker != nil {
+		t.Error("Expected customChecker to be nil after ResetSentinelMetrics")
+	}
+
+	// Re-registering the same name under a new instance, with a different
+	// type, must succeed since Reset wiped the prior registration.
+	registry := prometheus.NewRegistry()
+	NewSentinelMetrics(registry, testVersion)
+
+	if err := RegisterCustomMetric(CustomMetricSpec{Name: "shard_slo_total", Type: CustomMetricGauge, Labels: []string{"shard"}}); err != nil {
+		t.Errorf("Expected registration after reset to succeed, got: %v", err)
+	}
+}
+
+func TestRegisterCustomMetric_InvalidTypeDoesNotPoisonName(t *testing.T) {
+	initTestMetrics(t)
+
+	if err := RegisterCustomMetric(CustomMetricSpec{Name: "shard_slo_total", Type: "bogus", Labels: []string{"shard"}}); err == nil {
+		t.Fatal("Expected error for an unknown custom metric type, got nil")
+	}
+
+	// The rejected attempt must not have reserved the name, so a valid
+	// registration afterward should succeed.
+	if err := RegisterCustomMetric(CustomMetricSpec{Name: "shard_slo_total", Type: CustomMetricCounter, Labels: []string{"shard"}}); err != nil {
+		t.Errorf("Expected registration after an invalid-type attempt to succeed, got: %v", err)
+	}
+}
+
+func TestRegisterCustomMetric_BuiltinNameCollision(t *testing.T) {
+	initTestMetrics(t)
+
+	err := RegisterCustomMetric(CustomMetricSpec{Name: "pending_resources", Type: CustomMetricGauge, Labels: []string{"shard"}})
+	if err == nil {
+		t.Fatal("Expected error when a custom metric name collides with a built-in metric, got nil")
+	}
+}
+
+func TestRegisterCustomMetric_QueueCollectorNameCollisionReturnsError(t *testing.T) {
+	ResetSentinelMetrics()
+	registry := prometheus.NewRegistry()
+	m := NewSentinelMetricsWithQueue(registry, testVersion, WithFlushInterval(time.Hour))
+	defer m.Close()
+
+	err := RegisterCustomMetric(CustomMetricSpec{Name: "metric_queue_depth", Type: CustomMetricGauge, Labels: []string{"shard"}})
+	if err == nil {
+		t.Fatal("Expected error when a custom metric name collides with a queue collector, got nil")
+	}
+
+	// The failed attempt must not have reserved the name, so a
+	// non-colliding registration afterward still succeeds.
+	if err := RegisterCustomMetric(CustomMetricSpec{Name: "shard_backlog", Type: CustomMetricGauge, Labels: []string{"shard"}}); err != nil {
+		t.Errorf("Expected registration after a collision error to succeed, got: %v", err)
+	}
+}
+
+func TestRegisterCustomMetric_InheritsStandardLabels(t *testing.T) {
+	initTestMetrics(t)
+
+	if err := RegisterCustomMetric(CustomMetricSpec{Name: "shard_slo_total", Type: CustomMetricCounter, Labels: []string{"shard"}}); err != nil {
+		t.Fatalf("unexpected error registering metric: %v", err)
+	}
+
+	desc := make(chan *prometheus.Desc, 1)
+	customCounters.elements["shard_slo_total"].Describe(desc)
+	d := <-desc
+	descStr := d.String()
+
+	if !strings.Contains(descStr, `component="sentinel"`) {
+		t.Errorf("Expected custom metric to inherit component=\"sentinel\", got: %s", descStr)
+	}
+	if !strings.Contains(descStr, `version="`+testVersion+`"`) {
+		t.Errorf("Expected custom metric to inherit version=%q, got: %s", testVersion, descStr)
+	}
+}
@@ -0,0 +1,259 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultQueueSize     = 10000
+	defaultBatchSize     = 1000
+	defaultFlushInterval = 200 * time.Millisecond
+)
+
+// WithQueueSize sets the capacity of the buffered channel used by
+// NewSentinelMetricsWithQueue. Defaults to 10000.
+func WithQueueSize(size int) Option {
+	return func(o *metricsOptions) { o.queueSize = size }
+}
+
+// WithBatchSize sets how many queued updates the consumer goroutine applies
+// before flushing early, ahead of the flush interval. Defaults to 1000.
+func WithBatchSize(size int) Option {
+	return func(o *metricsOptions) { o.batchSize = size }
+}
+
+// WithFlushInterval sets the maximum time queued updates wait before being
+// applied, even if the batch size hasn't been reached. Defaults to 200ms.
+func WithFlushInterval(d time.Duration) Option {
+	return func(o *metricsOptions) { o.flushInterval = d }
+}
+
+// metricEvent is a lightweight record of a single Update* call, queued for a
+// consumer goroutine to apply in batches instead of contending on the
+// underlying vec's lock on every call.
+type metricEvent struct {
+	metric           string
+	resourceType     string
+	resourceSelector string
+	extra            string // reason or error_type, when the metric has one
+	value            float64
+}
+
+// queueMu guards queueEnabled and the collectors/channel below. Producers
+// (tryRecordEvent) take the read lock so any number of them can record
+// concurrently; stopQueue takes the write lock so it never nils out the
+// channel or collectors while a producer is mid-send. Holding the read lock
+// for the whole select+fallback is what keeps a producer from observing
+// queueEnabled==true and then reading a nilled-out eventQueue or
+// queueDroppedTotal.
+var (
+	queueMu      sync.RWMutex
+	queueEnabled bool
+
+	eventQueue  chan metricEvent
+	queueCancel context.CancelFunc
+	queueDone   chan struct{}
+
+	queueDepthGauge   prometheus.Gauge
+	queueDroppedTotal prometheus.Counter
+)
+
+// NewSentinelMetricsWithQueue is like NewSentinelMetrics, but routes every
+// Update* call through a buffered event queue drained by a single consumer
+// goroutine, so hot paths no longer contend on the underlying vec's lock.
+// Queued updates are flushed every batch size or flush interval (see
+// WithBatchSize and WithFlushInterval), whichever comes first. If the queue
+// is full, the update is applied synchronously instead of being dropped, and
+// hyperfleet_sentinel_metric_queue_dropped_total is incremented.
+func NewSentinelMetricsWithQueue(registry prometheus.Registerer, version string, opts ...Option) *SentinelMetrics {
+	m := NewSentinelMetrics(registry, version, opts...)
+
+	queueMu.Lock()
+	defer queueMu.Unlock()
+
+	if queueEnabled {
+		return m
+	}
+
+	options := &metricsOptions{
+		queueSize:     defaultQueueSize,
+		batchSize:     defaultBatchSize,
+		flushInterval: defaultFlushInterval,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	constLabels := prometheus.Labels{
+		"component": componentName,
+		"version":   version,
+	}
+
+	queueDepthGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Subsystem:   metricsSubsystem,
+		Name:        "metric_queue_depth",
+		Help:        "Current number of buffered metric updates awaiting the queue consumer.",
+		ConstLabels: constLabels,
+	})
+	queueDroppedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Subsystem:   metricsSubsystem,
+		Name:        "metric_queue_dropped_total",
+		Help:        "Total number of metric updates applied synchronously because the queue was full.",
+		ConstLabels: constLabels,
+	})
+	registry.MustRegister(queueDepthGauge, queueDroppedTotal)
+
+	eventQueue = make(chan metricEvent, options.queueSize)
+	queueDone = make(chan struct{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	queueCancel = cancel
+	queueEnabled = true
+
+	go runQueueConsumer(ctx, options.batchSize, options.flushInterval)
+
+	return m
+}
+
+// stopQueue stops the consumer goroutine, draining any buffered events
+// first, and is a no-op if queue mode was never enabled. It is called from
+// SentinelMetrics.Close so callers only need to manage one Close method.
+func stopQueue() {
+	queueMu.Lock()
+	defer queueMu.Unlock()
+
+	if !queueEnabled {
+		return
+	}
+
+	queueCancel()
+	<-queueDone
+
+	queueEnabled = false
+	eventQueue = nil
+	queueDepthGauge = nil
+	queueDroppedTotal = nil
+}
+
+func runQueueConsumer(ctx context.Context, batchSize int, flushInterval time.Duration) {
+	defer close(queueDone)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]metricEvent, 0, batchSize)
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		applyBatch(batch)
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case e := <-eventQueue:
+			batch = append(batch, e)
+			queueDepthGauge.Set(float64(len(eventQueue)))
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-ctx.Done():
+			for {
+				select {
+				case e := <-eventQueue:
+					batch = append(batch, e)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// tryRecordEvent applies e through the queue when queue mode is enabled,
+// falling back to a synchronous apply when the queue is full so no update is
+// ever dropped. It reports whether queue mode was enabled at all, so callers
+// know whether they still need to apply the update themselves. The whole
+// check-and-send happens under queueMu's read lock so it can never observe
+// queueEnabled as true and then read a channel or collector that stopQueue
+// has since nilled out.
+func tryRecordEvent(e metricEvent) bool {
+	queueMu.RLock()
+	defer queueMu.RUnlock()
+
+	if !queueEnabled {
+		return false
+	}
+
+	select {
+	case eventQueue <- e:
+		queueDepthGauge.Set(float64(len(eventQueue)))
+	default:
+		queueDroppedTotal.Inc()
+		applyBatch([]metricEvent{e})
+	}
+	return true
+}
+
+// applyBatch applies a batch of queued events to the underlying collectors.
+// Counter deltas for the same label combination are coalesced into a single
+// Add call; gauges and histograms are applied in order.
+func applyBatch(batch []metricEvent) {
+	type counterKey struct {
+		metric           string
+		resourceType     string
+		resourceSelector string
+		extra            string
+	}
+	deltas := make(map[counterKey]float64)
+
+	for _, e := range batch {
+		switch e.metric {
+		case "pending_resources":
+			pendingResourcesGauge.With(prometheus.Labels{
+				metricsResourceTypeLabel:     e.resourceType,
+				metricsResourceSelectorLabel: e.resourceSelector,
+			}).Set(e.value)
+			touch(e.metric, e.resourceType, e.resourceSelector, "")
+		case "poll_duration_seconds":
+			pollDurationHistogram.With(prometheus.Labels{
+				metricsResourceTypeLabel:     e.resourceType,
+				metricsResourceSelectorLabel: e.resourceSelector,
+			}).Observe(e.value)
+			touch(e.metric, e.resourceType, e.resourceSelector, "")
+		default:
+			deltas[counterKey{e.metric, e.resourceType, e.resourceSelector, e.extra}] += e.value
+		}
+	}
+
+	for k, delta := range deltas {
+		labels := prometheus.Labels{
+			metricsResourceTypeLabel:     k.resourceType,
+			metricsResourceSelectorLabel: k.resourceSelector,
+		}
+		switch k.metric {
+		case "events_published_total":
+			labels[metricsReasonLabel] = k.extra
+			eventsPublishedCounter.With(labels).Add(delta)
+		case "resources_skipped_total":
+			labels[metricsReasonLabel] = k.extra
+			resourcesSkippedCounter.With(labels).Add(delta)
+		case "api_errors_total":
+			labels[metricsErrorTypeLabel] = k.extra
+			apiErrorsCounter.With(labels).Add(delta)
+		case "broker_errors_total":
+			labels[metricsErrorTypeLabel] = k.extra
+			brokerErrorsCounter.With(labels).Add(delta)
+		}
+		touch(k.metric, k.resourceType, k.resourceSelector, k.extra)
+	}
+}
@@ -0,0 +1,136 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestNewSentinelMetricsWithQueue_BatchFlush(t *testing.T) {
+	ResetSentinelMetrics()
+	registry := prometheus.NewRegistry()
+	m := NewSentinelMetricsWithQueue(registry, testVersion, WithQueueSize(10), WithBatchSize(3), WithFlushInterval(time.Hour))
+	defer m.Close()
+
+	for i := 0; i < 3; i++ {
+		UpdateEventsPublishedMetric("clusters", "all", "test")
+	}
+
+	waitForCondition(t, func() bool {
+		return testutil.ToFloat64(eventsPublishedCounter.With(prometheus.Labels{
+			metricsResourceTypeLabel:     "clusters",
+			metricsResourceSelectorLabel: "all",
+			metricsReasonLabel:           "test",
+		})) == 3
+	})
+}
+
+func TestNewSentinelMetricsWithQueue_IntervalFlush(t *testing.T) {
+	ResetSentinelMetrics()
+	registry := prometheus.NewRegistry()
+	m := NewSentinelMetricsWithQueue(registry, testVersion, WithQueueSize(10), WithBatchSize(1000), WithFlushInterval(10*time.Millisecond))
+	defer m.Close()
+
+	UpdatePendingResourcesMetric("clusters", "all", 7)
+
+	waitForCondition(t, func() bool {
+		return testutil.ToFloat64(pendingResourcesGauge.With(prometheus.Labels{
+			metricsResourceTypeLabel:     "clusters",
+			metricsResourceSelectorLabel: "all",
+		})) == 7
+	})
+}
+
+func TestNewSentinelMetricsWithQueue_FullQueueFallsBackSynchronously(t *testing.T) {
+	ResetSentinelMetrics()
+	registry := prometheus.NewRegistry()
+	m := NewSentinelMetricsWithQueue(registry, testVersion, WithQueueSize(1), WithBatchSize(1000), WithFlushInterval(time.Hour))
+	defer m.Close()
+
+	// Stop the consumer so nothing ever drains eventQueue, then fill its
+	// one slot directly. That's what makes the queue genuinely full and
+	// unserviced, rather than racing tryRecordEvent's select against a
+	// live consumer goroutine still parked on the receive case - which,
+	// on an unbuffered or not-yet-full channel, can win the select and
+	// make the test flaky depending on GOMAXPROCS.
+	queueCancel()
+	<-queueDone
+	eventQueue <- metricEvent{metric: "api_errors_total", resourceType: "clusters", resourceSelector: "all", extra: "filler", value: 1}
+
+	UpdateAPIErrorsMetric("clusters", "all", "fetch_error")
+
+	if got := testutil.ToFloat64(apiErrorsCounter.With(prometheus.Labels{
+		metricsResourceTypeLabel:     "clusters",
+		metricsResourceSelectorLabel: "all",
+		metricsErrorTypeLabel:        "fetch_error",
+	})); got != 1 {
+		t.Errorf("Expected synchronous fallback to apply the update immediately, got %f", got)
+	}
+
+	if got := testutil.ToFloat64(queueDroppedTotal); got != 1 {
+		t.Errorf("Expected queue_dropped_total to be 1 after a full-queue fallback, got %f", got)
+	}
+}
+
+func TestSentinelMetrics_CloseDrainsQueueBeforeStopping(t *testing.T) {
+	ResetSentinelMetrics()
+	registry := prometheus.NewRegistry()
+	m := NewSentinelMetricsWithQueue(registry, testVersion, WithQueueSize(100), WithBatchSize(1000), WithFlushInterval(time.Hour))
+
+	for i := 0; i < 10; i++ {
+		UpdateResourcesSkippedMetric("clusters", "all", "within_max_age")
+	}
+
+	// Nothing has flushed yet: the batch size and interval are both far
+	// larger than what Close should wait for.
+	m.Close()
+
+	if got := testutil.ToFloat64(resourcesSkippedCounter.With(prometheus.Labels{
+		metricsResourceTypeLabel:     "clusters",
+		metricsResourceSelectorLabel: "all",
+		metricsReasonLabel:           "within_max_age",
+	})); got != 10 {
+		t.Errorf("Expected Close to drain all 10 queued updates, got %f", got)
+	}
+
+	if queueEnabled {
+		t.Error("Expected queueEnabled to be false after Close")
+	}
+}
+
+func TestApplyBatch_CoalescesCounterDeltas(t *testing.T) {
+	initTestMetrics(t)
+
+	applyBatch([]metricEvent{
+		{metric: "events_published_total", resourceType: "clusters", resourceSelector: "all", extra: "test", value: 1},
+		{metric: "events_published_total", resourceType: "clusters", resourceSelector: "all", extra: "test", value: 1},
+		{metric: "events_published_total", resourceType: "clusters", resourceSelector: "all", extra: "test", value: 1},
+	})
+
+	if got := testutil.ToFloat64(eventsPublishedCounter.With(prometheus.Labels{
+		metricsResourceTypeLabel:     "clusters",
+		metricsResourceSelectorLabel: "all",
+		metricsReasonLabel:           "test",
+	})); got != 3 {
+		t.Errorf("Expected coalesced counter delta of 3, got %f", got)
+	}
+}
+
+// waitForCondition polls cond until it's true or a short timeout elapses,
+// which is what we've got until the queue consumer is coordinated for tests
+// (Close already exercises the drain-on-shutdown path directly).
+func waitForCondition(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if !cond() {
+		t.Fatal("condition not met before timeout")
+	}
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestReapStaleSeries_DeletesExpiredSeries(t *testing.T) {
+	ResetSentinelMetrics()
+	registry := prometheus.NewRegistry()
+	NewSentinelMetrics(registry, testVersion, WithTTL(time.Minute))
+
+	UpdatePendingResourcesMetric("clusters", "shard:1", 5)
+	if got := testutil.CollectAndCount(pendingResourcesGauge); got != 1 {
+		t.Fatalf("Expected 1 series before expiration, got %d", got)
+	}
+
+	// Backdate the series' last-updated time past the TTL instead of
+	// sleeping, then drive the reaper directly rather than waiting for
+	// defaultReapInterval.
+	lastUpdated.Store(seriesKey{
+		collector:        "pending_resources",
+		resourceType:     "clusters",
+		resourceSelector: "shard:1",
+	}, time.Now().Add(-2*time.Minute))
+
+	reapStaleSeries(time.Minute)
+
+	if got := testutil.CollectAndCount(pendingResourcesGauge); got != 0 {
+		t.Errorf("Expected expired series to be deleted, got %d series", got)
+	}
+	if _, ok := lastUpdated.Load(seriesKey{collector: "pending_resources", resourceType: "clusters", resourceSelector: "shard:1"}); ok {
+		t.Error("Expected lastUpdated entry to be removed for the expired series")
+	}
+}
+
+func TestReapStaleSeries_KeepsFreshSeries(t *testing.T) {
+	ResetSentinelMetrics()
+	registry := prometheus.NewRegistry()
+	NewSentinelMetrics(registry, testVersion, WithTTL(time.Minute))
+
+	UpdatePendingResourcesMetric("clusters", "shard:1", 5)
+
+	reapStaleSeries(time.Minute)
+
+	if got := testutil.CollectAndCount(pendingResourcesGauge); got != 1 {
+		t.Errorf("Expected fresh series to survive a reap pass, got %d series", got)
+	}
+}
+
+func TestWithTTL_ZeroNeverExpires(t *testing.T) {
+	ResetSentinelMetrics()
+	registry := prometheus.NewRegistry()
+	m := NewSentinelMetrics(registry, testVersion)
+	defer m.Close()
+
+	if m.reapCancel != nil {
+		t.Error("Expected no reaper goroutine to be started when TTL is 0")
+	}
+}
+
+func TestSentinelMetrics_CloseStopsReaperGoroutine(t *testing.T) {
+	ResetSentinelMetrics()
+	registry := prometheus.NewRegistry()
+	m := NewSentinelMetrics(registry, testVersion, WithTTL(time.Minute))
+
+	if m.reapCancel == nil || m.reapDone == nil {
+		t.Fatal("Expected a reaper goroutine to be started when TTL is non-zero")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		m.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected Close to stop the reaper goroutine, but it leaked")
+	}
+
+	// Close must be idempotent and safe to call again.
+	m.Close()
+}